@@ -0,0 +1,51 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instrument
+
+import (
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/stats"
+
+	"github.com/streamingfast/sf-tracing"
+)
+
+func grpcOtelOptions(o *options) []otelgrpc.Option {
+	return []otelgrpc.Option{
+		otelgrpc.WithTracerProvider(singleTracerProvider{tracer: tracing.GetTracer()}),
+		otelgrpc.WithPropagators(tracing.Propagator()),
+		otelgrpc.WithFilter(func(info *stats.RPCTagInfo) bool {
+			return o.grpcFilter(info.FullMethodName)
+		}),
+	}
+}
+
+// ServerStatsHandler returns a grpc.ServerOption installing OTEL gRPC server
+// instrumentation pre-wired with the sf-tracing tracer and propagator. Pass
+// it to grpc.NewServer via grpc.StatsHandler. Calls whose full method is
+// filtered out (see WithGRPCFilter) are left untraced.
+func ServerStatsHandler(opts ...Option) grpc.ServerOption {
+	o := newOptions(opts...)
+	return grpc.StatsHandler(otelgrpc.NewServerHandler(grpcOtelOptions(o)...))
+}
+
+// ClientStatsHandler returns a grpc.DialOption installing OTEL gRPC client
+// instrumentation pre-wired with the sf-tracing tracer and propagator, for
+// calling traced gRPC services from a client. Pass it to grpc.NewClient (or
+// grpc.DialContext) via grpc.WithStatsHandler.
+func ClientStatsHandler(opts ...Option) grpc.DialOption {
+	o := newOptions(opts...)
+	return grpc.WithStatsHandler(otelgrpc.NewClientHandler(grpcOtelOptions(o)...))
+}
@@ -0,0 +1,71 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instrument
+
+import (
+	"fmt"
+	"net/http"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/streamingfast/sf-tracing"
+)
+
+func httpOtelOptions(operation string) []otelhttp.Option {
+	return []otelhttp.Option{
+		otelhttp.WithTracerProvider(singleTracerProvider{tracer: tracing.GetTracer()}),
+		otelhttp.WithPropagators(tracing.Propagator()),
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return fmt.Sprintf("%s %s", r.Method, r.URL.Path)
+		}),
+	}
+}
+
+// Handler wraps next with OTEL HTTP server instrumentation pre-wired with
+// the sf-tracing tracer and propagator. Requests filtered out (see
+// WithHTTPFilter, which by default skips `/healthz` and `/metrics`) are
+// passed straight to next, untraced.
+func Handler(operation string, next http.Handler, opts ...Option) http.Handler {
+	o := newOptions(opts...)
+	traced := otelhttp.NewHandler(next, operation, httpOtelOptions(operation)...)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !o.httpFilter(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		traced.ServeHTTP(w, r)
+	})
+}
+
+// Transport wraps next with OTEL HTTP client instrumentation pre-wired with
+// the sf-tracing tracer and propagator.
+func Transport(next http.RoundTripper, opts ...Option) http.RoundTripper {
+	o := newOptions(opts...)
+	traced := otelhttp.NewTransport(next, httpOtelOptions("")...)
+
+	return roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		if !o.httpFilter(r) {
+			return next.RoundTrip(r)
+		}
+		return traced.RoundTrip(r)
+	})
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) {
+	return f(r)
+}
@@ -0,0 +1,99 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package instrument provides ready-to-use gRPC and net/http instrumentation
+// wired through sf-tracing: the gRPC stats handlers (ServerStatsHandler,
+// ClientStatsHandler) and the HTTP Handler and Transport here are
+// pre-configured with the tracer returned by tracing.GetTracer() and the
+// propagator sf-tracing installs, so services don't have to re-implement
+// that wiring themselves. gRPC is instrumented through stats handlers only;
+// the package has no gRPC interceptors.
+package instrument
+
+import (
+	"net/http"
+	"strings"
+)
+
+// defaultIgnoredGRPCMethods are skipped by default, matching the "don't
+// trace non-existing routes" pattern used across StreamingFast services:
+// health checks generate constant background noise that isn't worth a
+// trace.
+var defaultIgnoredGRPCMethods = []string{
+	"/grpc.health.v1.Health/Check",
+	"/grpc.health.v1.Health/Watch",
+	"/grpc.reflection.v1alpha.ServerReflection/ServerReflectionInfo",
+}
+
+// defaultIgnoredHTTPPaths is the HTTP equivalent of defaultIgnoredGRPCMethods.
+var defaultIgnoredHTTPPaths = []string{
+	"/healthz",
+	"/metrics",
+}
+
+// options holds the shared configuration for every helper in this package.
+type options struct {
+	grpcFilter func(fullMethod string) bool
+	httpFilter func(r *http.Request) bool
+}
+
+// Option customizes the instrumentation helpers in this package.
+type Option func(*options)
+
+// WithGRPCFilter overrides which gRPC calls get traced. filter is called
+// with the RPC's full method (e.g. "/pkg.Service/Method"); returning false
+// skips tracing for that call. Defaults to skipping health checks and
+// server reflection.
+func WithGRPCFilter(filter func(fullMethod string) bool) Option {
+	return func(o *options) {
+		o.grpcFilter = filter
+	}
+}
+
+// WithHTTPFilter overrides which HTTP requests get traced. Defaults to
+// skipping `/healthz` and `/metrics`.
+func WithHTTPFilter(filter func(r *http.Request) bool) Option {
+	return func(o *options) {
+		o.httpFilter = filter
+	}
+}
+
+func newOptions(opts ...Option) *options {
+	o := &options{
+		grpcFilter: defaultGRPCFilter,
+		httpFilter: defaultHTTPFilter,
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+func defaultGRPCFilter(fullMethod string) bool {
+	for _, ignored := range defaultIgnoredGRPCMethods {
+		if fullMethod == ignored {
+			return false
+		}
+	}
+	return true
+}
+
+func defaultHTTPFilter(r *http.Request) bool {
+	for _, ignored := range defaultIgnoredHTTPPaths {
+		if strings.HasPrefix(r.URL.Path, ignored) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,34 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package instrument
+
+import (
+	ttrace "go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/embedded"
+)
+
+// singleTracerProvider adapts a single tracer into a trace.TracerProvider so
+// it can be handed to otelgrpc/otelhttp, which otherwise mint their own
+// named tracer off the global provider instead of using the one
+// tracing.GetTracer() returns.
+type singleTracerProvider struct {
+	embedded.TracerProvider
+
+	tracer ttrace.Tracer
+}
+
+func (p singleTracerProvider) Tracer(string, ...ttrace.TracerOption) ttrace.Tracer {
+	return p.tracer
+}
@@ -0,0 +1,145 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// otlpRetryConfig mirrors the retry/backoff knobs exposed by both the gRPC
+// and HTTP OTLP exporters, parsed from the `retry` (on/off), `retry_initial_interval`,
+// `retry_max_interval` and `retry_max_elapsed_time` query parameters (the
+// latter three as Go duration strings, e.g. "5s"). Retry is enabled by
+// default, matching the exporters' own defaults.
+type otlpRetryConfig struct {
+	Enabled         bool
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	MaxElapsedTime  time.Duration
+}
+
+func parseOTLPRetryConfig(u *url.URL) (otlpRetryConfig, error) {
+	cfg := otlpRetryConfig{
+		Enabled:         true,
+		InitialInterval: 5 * time.Second,
+		MaxInterval:     30 * time.Second,
+		MaxElapsedTime:  time.Minute,
+	}
+
+	q := u.Query()
+	if v := q.Get("retry"); v != "" {
+		enabled, err := strconv.ParseBool(v)
+		if err != nil {
+			return cfg, fmt.Errorf("parsing retry: %w", err)
+		}
+		cfg.Enabled = enabled
+	}
+
+	for param, dst := range map[string]*time.Duration{
+		"retry_initial_interval": &cfg.InitialInterval,
+		"retry_max_interval":     &cfg.MaxInterval,
+		"retry_max_elapsed_time": &cfg.MaxElapsedTime,
+	} {
+		if v := q.Get(param); v != "" {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return cfg, fmt.Errorf("parsing %s: %w", param, err)
+			}
+			*dst = d
+		}
+	}
+
+	return cfg, nil
+}
+
+// parseOTLPTLSConfig builds a *tls.Config from the `tls_cert`, `tls_key`,
+// `ca_cert` and `insecure` query parameters. It returns a nil config when
+// none of them are set, in which case the caller should fall back to a
+// plaintext connection.
+func parseOTLPTLSConfig(u *url.URL) (*tls.Config, error) {
+	q := u.Query()
+	certFile := q.Get("tls_cert")
+	keyFile := q.Get("tls_key")
+	caFile := q.Get("ca_cert")
+	insecure := q.Get("insecure")
+
+	if certFile == "" && keyFile == "" && caFile == "" && insecure != "false" {
+		return nil, nil
+	}
+
+	conf := &tls.Config{}
+
+	if certFile != "" || keyFile != "" {
+		if certFile == "" || keyFile == "" {
+			return nil, fmt.Errorf("tls_cert and tls_key must both be set for mTLS")
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate %q/%q: %w", certFile, keyFile, err)
+		}
+		conf.Certificates = []tls.Certificate{cert}
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading ca cert %q: %w", caFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in ca cert %q", caFile)
+		}
+		conf.RootCAs = pool
+	}
+
+	return conf, nil
+}
+
+// parseOTLPHeaders extracts static headers to send alongside every export
+// request. Individual headers are set with `header_<Name>=<value>` (e.g.
+// `header_Authorization=Bearer+xyz`); `basic_auth=user:pass` is a shorthand
+// for a Basic Authorization header.
+func parseOTLPHeaders(u *url.URL) (map[string]string, error) {
+	headers := map[string]string{}
+	for key, values := range u.Query() {
+		if !strings.HasPrefix(key, "header_") || len(values) == 0 {
+			continue
+		}
+		headers[strings.TrimPrefix(key, "header_")] = values[0]
+	}
+
+	if basicAuth := u.Query().Get("basic_auth"); basicAuth != "" {
+		user, pass, ok := strings.Cut(basicAuth, ":")
+		if !ok {
+			return nil, fmt.Errorf("basic_auth must be of the form user:pass")
+		}
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":"+pass))
+	}
+
+	return headers, nil
+}
+
+func isGzipEnabled(u *url.URL) bool {
+	enabled, _ := strconv.ParseBool(u.Query().Get("gzip"))
+	return enabled
+}
@@ -0,0 +1,67 @@
+package tracing
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseOTLPTLSConfig(t *testing.T) {
+	t.Run("no tls params returns nil config", func(t *testing.T) {
+		u, err := url.Parse("otelcol://collector:4317")
+		require.NoError(t, err)
+
+		cfg, err := parseOTLPTLSConfig(u)
+		require.NoError(t, err)
+		require.Nil(t, cfg)
+	})
+
+	t.Run("insecure=false forces a non-nil config", func(t *testing.T) {
+		u, err := url.Parse("otelcol://collector:4317?insecure=false")
+		require.NoError(t, err)
+
+		cfg, err := parseOTLPTLSConfig(u)
+		require.NoError(t, err)
+		require.NotNil(t, cfg)
+	})
+
+	t.Run("tls_cert without tls_key is an error", func(t *testing.T) {
+		u, err := url.Parse("otelcol://collector:4317?tls_cert=cert.pem")
+		require.NoError(t, err)
+
+		_, err = parseOTLPTLSConfig(u)
+		require.Error(t, err)
+	})
+}
+
+func TestParseOTLPHeaders(t *testing.T) {
+	t.Run("header_ prefixed params", func(t *testing.T) {
+		u, err := url.Parse("otelcol://collector:4317?header_Authorization=Bearer+xyz&header_X-Team=data")
+		require.NoError(t, err)
+
+		headers, err := parseOTLPHeaders(u)
+		require.NoError(t, err)
+		require.Equal(t, map[string]string{
+			"Authorization": "Bearer xyz",
+			"X-Team":        "data",
+		}, headers)
+	})
+
+	t.Run("basic_auth shorthand", func(t *testing.T) {
+		u, err := url.Parse("otelcol://collector:4317?basic_auth=user:pass")
+		require.NoError(t, err)
+
+		headers, err := parseOTLPHeaders(u)
+		require.NoError(t, err)
+		require.Equal(t, "Basic dXNlcjpwYXNz", headers["Authorization"])
+	})
+
+	t.Run("malformed basic_auth is an error", func(t *testing.T) {
+		u, err := url.Parse("otelcol://collector:4317?basic_auth=nocolonhere")
+		require.NoError(t, err)
+
+		_, err = parseOTLPHeaders(u)
+		require.Error(t, err)
+	})
+}
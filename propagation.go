@@ -0,0 +1,26 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import "go.opentelemetry.io/otel/propagation"
+
+// Propagator returns the propagator sf-tracing installs via
+// otel.SetTextMapPropagator on every register* path: W3C Trace Context plus
+// Baggage. Instrumentation helpers (see the instrument subpackage) use this
+// instead of hard-coding their own, so extraction/injection stays
+// consistent with what SetupOpenTelemetry configures.
+func Propagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})
+}
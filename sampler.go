@@ -0,0 +1,224 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// parseSampler builds the `trace.Sampler` described by the `sampler` and
+// `ratio` query parameters (e.g. `?sampler=parentbased_traceidratio&ratio=0.01`
+// or `?sampler=rules&rules=[...]`), falling back to the standard
+// `OTEL_TRACES_SAMPLER` / `OTEL_TRACES_SAMPLER_ARG` environment variables,
+// and finally to `parentbased_traceidratio` sampling everything
+// (ratio 1.0) when nothing is configured.
+//
+// Samplers whose name is prefixed with `parentbased_` are wrapped in
+// `trace.ParentBased` so that a sampled parent always forces its children to
+// be sampled too, matching the OpenTelemetry SDK's own naming convention.
+func parseSampler(u *url.URL) (trace.Sampler, error) {
+	sampler, _, err := parseSamplerWithDefaultRatio(u, 1.0)
+	return sampler, err
+}
+
+// parseSamplerWithDefaultRatio is like parseSampler but lets the caller pick
+// the ratio used when sampling is traceidratio-based and no ratio was
+// configured, for schemes (like cloudtrace) that historically defaulted to
+// something other than 1.0.
+//
+// The second return value reports whether the sampler's decision can vary
+// from one span to the next within the same trace (true for `rules`, since a
+// rule can match on span name or attributes), as opposed to samplers whose
+// decision only depends on the trace ID and is therefore already the same
+// for every span of a trace. samplingSpanProcessor uses this to decide
+// whether it needs to make its decision off the trace's root span instead of
+// each span individually.
+func parseSamplerWithDefaultRatio(u *url.URL, defaultRatio float64) (trace.Sampler, bool, error) {
+	q := u.Query()
+
+	kind := q.Get("sampler")
+	if kind == "" {
+		kind = os.Getenv("OTEL_TRACES_SAMPLER")
+	}
+	if kind == "" {
+		kind = "parentbased_traceidratio"
+	}
+
+	parentBased := strings.HasPrefix(kind, "parentbased_")
+	base := strings.TrimPrefix(kind, "parentbased_")
+
+	var sampler trace.Sampler
+	perSpanVarying := false
+	switch base {
+	case "always_on":
+		sampler = trace.AlwaysSample()
+	case "always_off":
+		sampler = trace.NeverSample()
+	case "traceidratio":
+		ratio := defaultRatio
+		ratioArg := q.Get("ratio")
+		if ratioArg == "" {
+			ratioArg = os.Getenv("OTEL_TRACES_SAMPLER_ARG")
+		}
+		if ratioArg != "" {
+			parsed, err := strconv.ParseFloat(ratioArg, 64)
+			if err != nil {
+				return nil, false, fmt.Errorf("parsing ratio: %w", err)
+			}
+			ratio = parsed
+		}
+		sampler = trace.TraceIDRatioBased(ratio)
+	case "rules":
+		ruleSampler, err := parseRuleSampler(q)
+		if err != nil {
+			return nil, false, err
+		}
+		sampler = ruleSampler
+		perSpanVarying = true
+	default:
+		return nil, false, fmt.Errorf("unsupported sampler %q", kind)
+	}
+
+	if parentBased {
+		return trace.ParentBased(sampler), perSpanVarying, nil
+	}
+	return sampler, perSpanVarying, nil
+}
+
+// samplerRule is one entry of the `rules` JSON array: an ordered matcher
+// evaluated top to bottom, the first match winning. A rule matches when all
+// of its non-empty match fields match; an empty match field is ignored.
+type samplerRule struct {
+	Match struct {
+		SpanNameGlob   string `json:"span_name_glob,omitempty"`
+		AttrKey        string `json:"attr_key,omitempty"`
+		AttrValueRegex string `json:"attr_value_regex,omitempty"`
+	} `json:"match"`
+	Ratio float64 `json:"ratio"`
+}
+
+// ruleBasedSampler evaluates an ordered list of rules matching on span name
+// (by glob) or on any span attribute such as the HTTP route or gRPC method
+// (by regex), falling back to a default ratio when no rule matches. The first
+// matching rule wins. Only the attributes passed in SamplingParameters are
+// searched; resource attributes are not matched.
+//
+// Because a rule's match fields can vary from one span to the next within
+// the same trace (e.g. a `span_name_glob` of `/health`, which only the root
+// span of that request is named), samplingSpanProcessor evaluates this
+// sampler once against the trace's root span and applies the resulting
+// decision to every span of the trace, rather than calling ShouldSample
+// independently per span -- see its perSpanVarying handling.
+type ruleBasedSampler struct {
+	rules        []compiledSamplerRule
+	defaultRatio trace.Sampler
+}
+
+type compiledSamplerRule struct {
+	spanNameGlob   string
+	attrKey        attribute.Key
+	attrValueRegex *regexp.Regexp
+	sampler        trace.Sampler
+}
+
+func parseRuleSampler(q url.Values) (trace.Sampler, error) {
+	raw := q.Get("rules")
+	if raw == "" {
+		return nil, fmt.Errorf("sampler=rules requires a rules query parameter")
+	}
+
+	var rules []samplerRule
+	if err := json.Unmarshal([]byte(raw), &rules); err != nil {
+		return nil, fmt.Errorf("parsing rules: %w", err)
+	}
+
+	compiled := make([]compiledSamplerRule, 0, len(rules))
+	for _, rule := range rules {
+		c := compiledSamplerRule{
+			spanNameGlob: rule.Match.SpanNameGlob,
+			attrKey:      attribute.Key(rule.Match.AttrKey),
+			sampler:      trace.TraceIDRatioBased(rule.Ratio),
+		}
+		if rule.Match.AttrValueRegex != "" {
+			re, err := regexp.Compile(rule.Match.AttrValueRegex)
+			if err != nil {
+				return nil, fmt.Errorf("compiling attr_value_regex %q: %w", rule.Match.AttrValueRegex, err)
+			}
+			c.attrValueRegex = re
+		}
+		compiled = append(compiled, c)
+	}
+
+	defaultRatio := 1.0
+	if v := q.Get("default_ratio"); v != "" {
+		parsed, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing default_ratio: %w", err)
+		}
+		defaultRatio = parsed
+	}
+
+	return &ruleBasedSampler{rules: compiled, defaultRatio: trace.TraceIDRatioBased(defaultRatio)}, nil
+}
+
+func (s *ruleBasedSampler) ShouldSample(params trace.SamplingParameters) trace.SamplingResult {
+	for _, rule := range s.rules {
+		if rule.matches(params) {
+			return rule.sampler.ShouldSample(params)
+		}
+	}
+	return s.defaultRatio.ShouldSample(params)
+}
+
+func (s *ruleBasedSampler) Description() string {
+	return "RuleBasedSampler"
+}
+
+func (r compiledSamplerRule) matches(params trace.SamplingParameters) bool {
+	if r.spanNameGlob != "" {
+		ok, err := path.Match(r.spanNameGlob, params.Name)
+		if err != nil || !ok {
+			return false
+		}
+	}
+
+	if r.attrKey != "" {
+		found := false
+		for _, attr := range params.Attributes {
+			if attr.Key != r.attrKey {
+				continue
+			}
+			if r.attrValueRegex == nil || r.attrValueRegex.MatchString(attr.Value.Emit()) {
+				found = true
+			}
+			break
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,139 @@
+package tracing
+
+import (
+	"context"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+func TestParseRuleSampler(t *testing.T) {
+	t.Run("missing rules param is an error", func(t *testing.T) {
+		_, err := parseRuleSampler(url.Values{})
+		require.Error(t, err)
+	})
+
+	t.Run("invalid json is an error", func(t *testing.T) {
+		_, err := parseRuleSampler(url.Values{"rules": {"not json"}})
+		require.Error(t, err)
+	})
+
+	t.Run("invalid attr_value_regex is an error", func(t *testing.T) {
+		_, err := parseRuleSampler(url.Values{
+			"rules": {`[{"match":{"attr_key":"http.route","attr_value_regex":"("}, "ratio":1}]`},
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("parses rules and default_ratio", func(t *testing.T) {
+		sampler, err := parseRuleSampler(url.Values{
+			"rules":         {`[{"match":{"span_name_glob":"/health"}, "ratio":0}]`},
+			"default_ratio": {"0.5"},
+		})
+		require.NoError(t, err)
+		require.IsType(t, &ruleBasedSampler{}, sampler)
+	})
+}
+
+func TestRuleBasedSampler_ShouldSample(t *testing.T) {
+	sampler, err := parseRuleSampler(url.Values{
+		"rules": {`[
+			{"match":{"span_name_glob":"/health"}, "ratio":0},
+			{"match":{"attr_key":"http.status_code","attr_value_regex":"^5"}, "ratio":1}
+		]`},
+		"default_ratio": {"1"},
+	})
+	require.NoError(t, err)
+
+	t.Run("matches span name glob", func(t *testing.T) {
+		result := sampler.ShouldSample(trace.SamplingParameters{Name: "/health"})
+		require.Equal(t, trace.Drop, result.Decision)
+	})
+
+	t.Run("matches attribute regex", func(t *testing.T) {
+		result := sampler.ShouldSample(trace.SamplingParameters{
+			Name:       "GET /orders",
+			Attributes: []attribute.KeyValue{attribute.Int("http.status_code", 503)},
+		})
+		require.Equal(t, trace.RecordAndSample, result.Decision)
+	})
+
+	t.Run("falls back to default_ratio when nothing matches", func(t *testing.T) {
+		result := sampler.ShouldSample(trace.SamplingParameters{Name: "GET /orders"})
+		require.Equal(t, trace.RecordAndSample, result.Decision)
+	})
+}
+
+// TestSamplingSpanProcessor_RuleDecisionAppliesToWholeTrace guards against
+// the rule sampler deciding per span instead of per trace: a child span
+// that ends before its root (the common case) must not be exported on its
+// own just because its own name doesn't match a rule that drops the trace.
+func TestSamplingSpanProcessor_RuleDecisionAppliesToWholeTrace(t *testing.T) {
+	rules := url.Values{
+		"rules":         {`[{"match":{"span_name_glob":"/health"}, "ratio":0}]`},
+		"default_ratio": {"1"},
+	}
+	sampler, err := parseRuleSampler(rules)
+	require.NoError(t, err)
+
+	next := &recordingSpanProcessor{}
+	proc := newSamplingSpanProcessor(next, sampler, true)
+
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(trace.AlwaysSample()),
+		trace.WithSpanProcessor(proc),
+	)
+	tr := tp.Tracer("test")
+
+	ctx, root := tr.Start(context.Background(), "/health")
+	_, child := tr.Start(ctx, "db.query")
+	child.End()
+	root.End()
+
+	require.Empty(t, next.names, "child of a dropped trace must not be exported on its own")
+}
+
+func TestSamplingSpanProcessor_RuleDecisionKeepsWholeTrace(t *testing.T) {
+	rules := url.Values{
+		"rules":         {`[{"match":{"span_name_glob":"/health"}, "ratio":0}]`},
+		"default_ratio": {"1"},
+	}
+	sampler, err := parseRuleSampler(rules)
+	require.NoError(t, err)
+
+	next := &recordingSpanProcessor{}
+	proc := newSamplingSpanProcessor(next, sampler, true)
+
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(trace.AlwaysSample()),
+		trace.WithSpanProcessor(proc),
+	)
+	tr := tp.Tracer("test")
+
+	ctx, root := tr.Start(context.Background(), "GET /orders")
+	_, child := tr.Start(ctx, "db.query")
+	child.End()
+	root.End()
+
+	require.ElementsMatch(t, []string{"db.query", "GET /orders"}, next.names)
+}
+
+// recordingSpanProcessor is a trace.SpanProcessor that just remembers the
+// name of every span it sees, for asserting on what a wrapping processor
+// forwarded.
+type recordingSpanProcessor struct {
+	names []string
+}
+
+func (r *recordingSpanProcessor) OnStart(context.Context, trace.ReadWriteSpan) {}
+
+func (r *recordingSpanProcessor) OnEnd(s trace.ReadOnlySpan) {
+	r.names = append(r.names, s.Name())
+}
+
+func (r *recordingSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (r *recordingSpanProcessor) ForceFlush(context.Context) error { return nil }
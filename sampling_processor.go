@@ -0,0 +1,231 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+	ttrace "go.opentelemetry.io/otel/trace"
+)
+
+// defaultRuleRootTimeout bounds how long samplingSpanProcessor buffers a
+// trace waiting for its root span when perSpanVarying is set, in case the
+// root never ends (e.g. a long-lived background span, or one dropped
+// upstream) -- past it, the buffered spans are decided off the oldest one
+// seen instead of being held forever.
+const defaultRuleRootTimeout = 30 * time.Second
+
+// defaultRuleMaxTraces bounds the number of traces buffered at once while
+// waiting for their root span; past it, the oldest pending trace is decided
+// early to make room.
+const defaultRuleMaxTraces = 10_000
+
+// samplingSpanProcessor wraps a trace.SpanProcessor and only forwards spans
+// to it when sampler decides the span's trace should be recorded and
+// sampled. It exists so registerFanOut can give each exporter in a
+// multi-exporter `SF_TRACING` its own sampling rate off a single
+// TracerProvider, whose own sampler must stay permissive (AlwaysSample) for
+// every processor to even see the spans in the first place.
+//
+// When perSpanVarying is set (a rules sampler, whose decision can depend on
+// a span's own name or attributes), the decision is instead made once per
+// *trace*, off the trace's root span, and applied to every span of that
+// trace -- otherwise a rule like "sample /health at 0%" would only drop the
+// one span named "/health" while its children (DB calls, downstream RPCs)
+// fall through to the default ratio and get exported anyway, leaving an
+// orphaned partial trace.
+type samplingSpanProcessor struct {
+	next           trace.SpanProcessor
+	sampler        trace.Sampler
+	perSpanVarying bool
+
+	mu     sync.Mutex
+	traces map[ttrace.TraceID]*pendingRuleTrace
+	lru    *list.List // front = most recently touched, back = oldest
+}
+
+// pendingRuleTrace accumulates the spans seen so far for one trace while
+// samplingSpanProcessor waits for that trace's root span to end.
+type pendingRuleTrace struct {
+	spans   []trace.ReadOnlySpan
+	timer   *time.Timer
+	element *list.Element
+}
+
+func newSamplingSpanProcessor(next trace.SpanProcessor, sampler trace.Sampler, perSpanVarying bool) *samplingSpanProcessor {
+	p := &samplingSpanProcessor{next: next, sampler: sampler, perSpanVarying: perSpanVarying}
+	if perSpanVarying {
+		p.traces = make(map[ttrace.TraceID]*pendingRuleTrace)
+		p.lru = list.New()
+	}
+	return p
+}
+
+func (p *samplingSpanProcessor) OnStart(ctx context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(ctx, s)
+}
+
+func (p *samplingSpanProcessor) OnEnd(s trace.ReadOnlySpan) {
+	if !p.perSpanVarying {
+		if p.shouldSample(s) {
+			p.next.OnEnd(s)
+		}
+		return
+	}
+	p.onEndRootSticky(s)
+}
+
+// onEndRootSticky buffers s until its trace's root span (one whose parent
+// span context is invalid) ends, then evaluates the sampler against that
+// root and forwards every buffered span of the trace if it decided to keep
+// it. A non-root span that ends after its trace was already decided (rare,
+// since child spans usually end before their parent) is not matched to that
+// earlier decision: it is buffered again as a new pending trace and decided
+// off the oldest of those spans once defaultRuleRootTimeout elapses.
+func (p *samplingSpanProcessor) onEndRootSticky(s trace.ReadOnlySpan) {
+	traceID := s.SpanContext().TraceID()
+	isRoot := !s.Parent().SpanID().IsValid()
+
+	p.mu.Lock()
+	pt, ok := p.traces[traceID]
+	if !ok {
+		if isRoot {
+			// No earlier spans are buffered for this trace: common case of
+			// a short, synchronous request where the root only starts
+			// after sf-tracing is set up. Nothing to apply the decision to
+			// yet besides s itself.
+			p.mu.Unlock()
+			if p.shouldSample(s) {
+				p.next.OnEnd(s)
+			}
+			return
+		}
+		pt = &pendingRuleTrace{}
+		p.traces[traceID] = pt
+		pt.element = p.lru.PushFront(traceID)
+		pt.timer = time.AfterFunc(defaultRuleRootTimeout, func() { p.decide(traceID, nil) })
+		p.evictOverflowLocked()
+	} else {
+		p.lru.MoveToFront(pt.element)
+	}
+	pt.spans = append(pt.spans, s)
+	p.mu.Unlock()
+
+	if isRoot {
+		p.decide(traceID, s)
+	}
+}
+
+// decide applies the sampler's decision to every span buffered so far for
+// traceID (which already includes root, if the caller has one -- see
+// onEndRootSticky). root is evaluated when given; otherwise (the
+// defaultRuleRootTimeout/Shutdown path, where the real root never showed
+// up) the oldest buffered span stands in for it.
+func (p *samplingSpanProcessor) decide(traceID ttrace.TraceID, root trace.ReadOnlySpan) {
+	p.mu.Lock()
+	pt, ok := p.traces[traceID]
+	if ok {
+		delete(p.traces, traceID)
+		p.lru.Remove(pt.element)
+		pt.timer.Stop()
+	}
+	p.mu.Unlock()
+	if !ok {
+		return
+	}
+
+	decisionSpan := root
+	if decisionSpan == nil && len(pt.spans) > 0 {
+		decisionSpan = pt.spans[0]
+	}
+	if decisionSpan == nil || !p.shouldSample(decisionSpan) {
+		return
+	}
+	for _, sp := range pt.spans {
+		p.next.OnEnd(sp)
+	}
+}
+
+// evictOverflowLocked decides the oldest pending traces early once the
+// bounded LRU is over capacity, trading a little precision for a hard
+// memory ceiling. The evicted trace is sampled and forwarded in a goroutine
+// so next.OnEnd is not called while p.mu is held. Callers must hold p.mu.
+func (p *samplingSpanProcessor) evictOverflowLocked() {
+	for len(p.traces) > defaultRuleMaxTraces {
+		oldest := p.lru.Back()
+		if oldest == nil {
+			return
+		}
+		// Removed here (under the lock we already hold) so the next loop
+		// iteration's len(p.traces) check reflects the eviction instead of
+		// racing the background forwarding below.
+		p.lru.Remove(oldest)
+		traceID := oldest.Value.(ttrace.TraceID)
+		pt := p.traces[traceID]
+		delete(p.traces, traceID)
+		pt.timer.Stop()
+		go func() {
+			if p.shouldSample(pt.spans[0]) {
+				for _, sp := range pt.spans {
+					p.next.OnEnd(sp)
+				}
+			}
+		}()
+	}
+}
+
+func (p *samplingSpanProcessor) Shutdown(ctx context.Context) error {
+	if p.perSpanVarying {
+		p.mu.Lock()
+		traceIDs := make([]ttrace.TraceID, 0, len(p.traces))
+		for traceID := range p.traces {
+			traceIDs = append(traceIDs, traceID)
+		}
+		p.mu.Unlock()
+		for _, traceID := range traceIDs {
+			p.decide(traceID, nil)
+		}
+	}
+	return p.next.Shutdown(ctx)
+}
+
+func (p *samplingSpanProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
+
+func (p *samplingSpanProcessor) shouldSample(s trace.ReadOnlySpan) bool {
+	sc := s.SpanContext()
+	sdkLinks := s.Links()
+	links := make([]ttrace.Link, len(sdkLinks))
+	for i, l := range sdkLinks {
+		links[i] = ttrace.Link{
+			SpanContext: l.SpanContext,
+			Attributes:  l.Attributes,
+		}
+	}
+	result := p.sampler.ShouldSample(trace.SamplingParameters{
+		ParentContext: context.Background(),
+		TraceID:       sc.TraceID(),
+		Name:          s.Name(),
+		Kind:          s.SpanKind(),
+		Attributes:    s.Attributes(),
+		Links:         links,
+	})
+	return result.Decision == trace.RecordAndSample
+}
@@ -0,0 +1,80 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+var (
+	providersMu sync.Mutex
+	providers   []*trace.TracerProvider
+)
+
+// trackProvider registers tp so that Shutdown and ForceFlush fan out to it.
+// Called once per SetupOpenTelemetry invocation that creates a
+// TracerProvider (not for the unset or noop:// / none:// cases); safe to call
+// concurrently, e.g. from tests or multi-tenant binaries that set up
+// tracing more than once.
+func trackProvider(tp *trace.TracerProvider) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers = append(providers, tp)
+}
+
+// Shutdown flushes and shuts down every TracerProvider created so far by
+// SetupOpenTelemetry. It fans out to all of them so that one failing
+// exporter doesn't prevent the others from shutting down cleanly. Safe to
+// call even if SetupOpenTelemetry was never called, or returned early
+// because `SF_TRACING` was unset.
+func Shutdown(ctx context.Context) error {
+	return fanOut(func(tp *trace.TracerProvider) error {
+		return tp.Shutdown(ctx)
+	})
+}
+
+// ForceFlush flushes pending spans on every TracerProvider created so far by
+// SetupOpenTelemetry. Call this before a short-lived job exits, or ahead of
+// a graceful restart, to make sure batched spans aren't lost -- Shutdown
+// already flushes, so ForceFlush is only needed when the process intends to
+// keep tracing afterwards.
+func ForceFlush(ctx context.Context) error {
+	return fanOut(func(tp *trace.TracerProvider) error {
+		return tp.ForceFlush(ctx)
+	})
+}
+
+func fanOut(fn func(tp *trace.TracerProvider) error) error {
+	providersMu.Lock()
+	tps := make([]*trace.TracerProvider, len(providers))
+	copy(tps, providers)
+	providersMu.Unlock()
+
+	var errs []string
+	for _, tp := range tps {
+		if err := fn(tp); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d of %d tracer providers failed: %s", len(errs), len(tps), strings.Join(errs, "; "))
+}
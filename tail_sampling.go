@@ -0,0 +1,224 @@
+// Copyright 2019 dfuse Platform Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracing
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	ttrace "go.opentelemetry.io/otel/trace"
+)
+
+// defaultTailSamplingMaxTraces bounds the number of traces a
+// tailSamplingSpanProcessor buffers at once; past it, the oldest pending
+// trace is evicted (and exported, not dropped) to make room, trading a
+// little precision for a hard memory ceiling.
+const defaultTailSamplingMaxTraces = 10_000
+
+// tailSamplingConfig is parsed off the `tail_*` query parameters on an
+// `SF_TRACING` exporter URL. A nil config means tail sampling is disabled
+// for that exporter and spans are forwarded as usual (head-sampled only).
+type tailSamplingConfig struct {
+	keepOnError bool
+	latency     time.Duration
+	window      time.Duration
+	maxTraces   int
+}
+
+// parseTailSamplingConfig returns nil, nil when none of `tail_error`,
+// `tail_latency_ms` or `tail_window` is present, so exporters that don't opt
+// in pay no cost. `tail_max_traces` alone does not enable tail sampling.
+func parseTailSamplingConfig(u *url.URL) (*tailSamplingConfig, error) {
+	q := u.Query()
+	if q.Get("tail_error") == "" && q.Get("tail_latency_ms") == "" && q.Get("tail_window") == "" {
+		return nil, nil
+	}
+
+	cfg := &tailSamplingConfig{
+		keepOnError: true,
+		window:      5 * time.Second,
+		maxTraces:   defaultTailSamplingMaxTraces,
+	}
+
+	if v := q.Get("tail_error"); v != "" {
+		parsed, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing tail_error: %w", err)
+		}
+		cfg.keepOnError = parsed
+	}
+
+	if v := q.Get("tail_latency_ms"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing tail_latency_ms: %w", err)
+		}
+		cfg.latency = time.Duration(parsed) * time.Millisecond
+	}
+
+	if v := q.Get("tail_window"); v != "" {
+		parsed, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing tail_window: %w", err)
+		}
+		cfg.window = parsed
+	}
+
+	if v := q.Get("tail_max_traces"); v != "" {
+		parsed, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("parsing tail_max_traces: %w", err)
+		}
+		cfg.maxTraces = parsed
+	}
+
+	return cfg, nil
+}
+
+// pendingTrace accumulates the spans seen so far for one trace while a
+// tailSamplingSpanProcessor waits out its decision window.
+type pendingTrace struct {
+	spans   []trace.ReadOnlySpan
+	keep    bool
+	timer   *time.Timer
+	element *list.Element // position in tailSamplingSpanProcessor.lru
+}
+
+// tailSamplingSpanProcessor buffers spans per trace ID for cfg.window and
+// then either forwards the whole trace to next or discards it, keeping only
+// traces that contain an error span or a span slower than cfg.latency.
+//
+// The decision is made once the window has elapsed rather than as each span
+// ends, so it cannot be composed with head sampling on the same exporter;
+// see registerFanOut.
+type tailSamplingSpanProcessor struct {
+	next trace.SpanProcessor
+	cfg  tailSamplingConfig
+
+	mu     sync.Mutex
+	traces map[ttrace.TraceID]*pendingTrace
+	lru    *list.List // front = most recently touched, back = oldest
+}
+
+func newTailSamplingSpanProcessor(next trace.SpanProcessor, cfg tailSamplingConfig) *tailSamplingSpanProcessor {
+	return &tailSamplingSpanProcessor{
+		next:   next,
+		cfg:    cfg,
+		traces: make(map[ttrace.TraceID]*pendingTrace),
+		lru:    list.New(),
+	}
+}
+
+func (p *tailSamplingSpanProcessor) OnStart(ctx context.Context, s trace.ReadWriteSpan) {
+	p.next.OnStart(ctx, s)
+}
+
+func (p *tailSamplingSpanProcessor) OnEnd(s trace.ReadOnlySpan) {
+	traceID := s.SpanContext().TraceID()
+	keep := p.cfg.keepOnError && s.Status().Code == codes.Error
+	if p.cfg.latency > 0 && s.EndTime().Sub(s.StartTime()) >= p.cfg.latency {
+		keep = true
+	}
+
+	p.mu.Lock()
+	pt, ok := p.traces[traceID]
+	if !ok {
+		pt = &pendingTrace{}
+		p.traces[traceID] = pt
+		pt.element = p.lru.PushFront(traceID)
+		pt.timer = time.AfterFunc(p.cfg.window, func() { p.decide(traceID) })
+		p.evictOverflowLocked()
+	} else {
+		p.lru.MoveToFront(pt.element)
+	}
+	pt.spans = append(pt.spans, s)
+	if keep {
+		pt.keep = true
+	}
+	p.mu.Unlock()
+}
+
+// decide is invoked once cfg.window has elapsed since a trace's first span,
+// forwarding its buffered spans to next if the trace was marked for keeping,
+// discarding them otherwise.
+func (p *tailSamplingSpanProcessor) decide(traceID ttrace.TraceID) {
+	p.mu.Lock()
+	pt, ok := p.traces[traceID]
+	if !ok {
+		p.mu.Unlock()
+		return
+	}
+	delete(p.traces, traceID)
+	p.lru.Remove(pt.element)
+	p.mu.Unlock()
+
+	if pt.keep {
+		for _, s := range pt.spans {
+			p.next.OnEnd(s)
+		}
+	}
+}
+
+// evictOverflowLocked drops the oldest pending trace once the bounded LRU is
+// full, exporting its buffered spans (rather than silently dropping them) so
+// a burst of traffic trades sampling precision for memory, not data loss.
+// Callers must hold p.mu.
+func (p *tailSamplingSpanProcessor) evictOverflowLocked() {
+	for len(p.traces) > p.cfg.maxTraces {
+		oldest := p.lru.Back()
+		if oldest == nil {
+			return
+		}
+		traceID := oldest.Value.(ttrace.TraceID)
+		pt := p.traces[traceID]
+		pt.timer.Stop()
+		delete(p.traces, traceID)
+		p.lru.Remove(oldest)
+
+		spans := pt.spans
+		go func() {
+			for _, s := range spans {
+				p.next.OnEnd(s)
+			}
+		}()
+	}
+}
+
+func (p *tailSamplingSpanProcessor) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	for traceID, pt := range p.traces {
+		pt.timer.Stop()
+		if pt.keep {
+			for _, s := range pt.spans {
+				p.next.OnEnd(s)
+			}
+		}
+		delete(p.traces, traceID)
+	}
+	p.mu.Unlock()
+
+	return p.next.Shutdown(ctx)
+}
+
+func (p *tailSamplingSpanProcessor) ForceFlush(ctx context.Context) error {
+	return p.next.ForceFlush(ctx)
+}
@@ -0,0 +1,141 @@
+package tracing
+
+import (
+	"context"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	ttrace "go.opentelemetry.io/otel/trace"
+)
+
+func TestParseTailSamplingConfig(t *testing.T) {
+	t.Run("no tail_ params returns nil config", func(t *testing.T) {
+		u, err := url.Parse("otelcol://collector:4317")
+		require.NoError(t, err)
+
+		cfg, err := parseTailSamplingConfig(u)
+		require.NoError(t, err)
+		require.Nil(t, cfg)
+	})
+
+	t.Run("defaults", func(t *testing.T) {
+		u, err := url.Parse("otelcol://collector:4317?tail_error=true")
+		require.NoError(t, err)
+
+		cfg, err := parseTailSamplingConfig(u)
+		require.NoError(t, err)
+		require.True(t, cfg.keepOnError)
+		require.Equal(t, 5*time.Second, cfg.window)
+		require.Equal(t, defaultTailSamplingMaxTraces, cfg.maxTraces)
+	})
+
+	t.Run("overrides", func(t *testing.T) {
+		u, err := url.Parse("otelcol://collector:4317?tail_error=false&tail_latency_ms=250&tail_window=2s&tail_max_traces=5")
+		require.NoError(t, err)
+
+		cfg, err := parseTailSamplingConfig(u)
+		require.NoError(t, err)
+		require.False(t, cfg.keepOnError)
+		require.Equal(t, 250*time.Millisecond, cfg.latency)
+		require.Equal(t, 2*time.Second, cfg.window)
+		require.Equal(t, 5, cfg.maxTraces)
+	})
+
+	t.Run("invalid tail_latency_ms is an error", func(t *testing.T) {
+		u, err := url.Parse("otelcol://collector:4317?tail_latency_ms=notanumber")
+		require.NoError(t, err)
+
+		_, err = parseTailSamplingConfig(u)
+		require.Error(t, err)
+	})
+
+	t.Run("invalid tail_window is an error", func(t *testing.T) {
+		u, err := url.Parse("otelcol://collector:4317?tail_window=notaduration")
+		require.NoError(t, err)
+
+		_, err = parseTailSamplingConfig(u)
+		require.Error(t, err)
+	})
+}
+
+func newTailSamplingTestProvider(cfg tailSamplingConfig) (*trace.TracerProvider, *recordingSpanProcessor) {
+	next := &recordingSpanProcessor{}
+	proc := newTailSamplingSpanProcessor(next, cfg)
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(trace.AlwaysSample()),
+		trace.WithSpanProcessor(proc),
+	)
+	return tp, next
+}
+
+func TestTailSamplingSpanProcessor_DropsQuietTraces(t *testing.T) {
+	tp, next := newTailSamplingTestProvider(tailSamplingConfig{
+		keepOnError: true,
+		window:      20 * time.Millisecond,
+		maxTraces:   defaultTailSamplingMaxTraces,
+	})
+	tr := tp.Tracer("test")
+
+	_, span := tr.Start(context.Background(), "quiet.op")
+	span.End()
+
+	time.Sleep(60 * time.Millisecond)
+	require.Empty(t, next.names, "a trace with no error or latency breach should be dropped once its window elapses")
+}
+
+func TestTailSamplingSpanProcessor_KeepsErrorTraces(t *testing.T) {
+	tp, next := newTailSamplingTestProvider(tailSamplingConfig{
+		keepOnError: true,
+		window:      20 * time.Millisecond,
+		maxTraces:   defaultTailSamplingMaxTraces,
+	})
+	tr := tp.Tracer("test")
+
+	_, span := tr.Start(context.Background(), "failing.op")
+	span.SetStatus(codes.Error, "boom")
+	span.End()
+
+	require.Eventually(t, func() bool {
+		return len(next.names) == 1
+	}, 200*time.Millisecond, 10*time.Millisecond, "trace with an error span should be forwarded once its window elapses")
+}
+
+func TestTailSamplingSpanProcessor_KeepsSlowTraces(t *testing.T) {
+	tp, next := newTailSamplingTestProvider(tailSamplingConfig{
+		latency:   100 * time.Millisecond,
+		window:    20 * time.Millisecond,
+		maxTraces: defaultTailSamplingMaxTraces,
+	})
+	tr := tp.Tracer("test")
+
+	start := time.Now()
+	_, span := tr.Start(context.Background(), "slow.op", ttrace.WithTimestamp(start))
+	span.End(ttrace.WithTimestamp(start.Add(200 * time.Millisecond)))
+
+	require.Eventually(t, func() bool {
+		return len(next.names) == 1
+	}, 200*time.Millisecond, 10*time.Millisecond, "trace slower than cfg.latency should be forwarded once its window elapses")
+}
+
+func TestTailSamplingSpanProcessor_EvictsOldestOnOverflow(t *testing.T) {
+	tp, next := newTailSamplingTestProvider(tailSamplingConfig{
+		window:    time.Hour, // long enough that only eviction (not the timer) forwards the first trace
+		maxTraces: 1,
+	})
+	tr := tp.Tracer("test")
+
+	_, first := tr.Start(context.Background(), "first.op")
+	first.End()
+
+	_, second := tr.Start(context.Background(), "second.op")
+	second.End()
+
+	require.Eventually(t, func() bool {
+		return len(next.names) >= 1
+	}, 200*time.Millisecond, 10*time.Millisecond, "overflowing the bounded LRU should export the oldest pending trace rather than drop it")
+	require.Contains(t, next.names, "first.op")
+}
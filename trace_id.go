@@ -2,14 +2,71 @@ package tracing
 
 import (
 	"context"
+	cryptorand "crypto/rand"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"math/rand"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 	ttrace "go.opentelemetry.io/otel/trace"
-	"runtime/debug"
 )
 
+// config holds the active idGenerator, following the same swappable,
+// atomically-loaded config pattern OpenCensus's trace package used; nothing
+// in this package ever stores anything else into it, but it's kept as an
+// atomic.Value rather than a plain var so NewRandomTraceID/NewRandomSpanID
+// stay safe to call concurrently with the package init that populates it.
+var config atomic.Value
+
+func init() {
+	config.Store(newDefaultIDGenerator())
+}
+
+// idGenerator mints random trace and span IDs.
+type idGenerator interface {
+	NewTraceID() ttrace.TraceID
+	NewSpanID() ttrace.SpanID
+}
+
+// defaultIDGenerator generates IDs from a math/rand source seeded off the
+// runtime's crypto-random seed; it's guarded by a mutex since *rand.Rand is
+// not safe for concurrent use.
+type defaultIDGenerator struct {
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+func newDefaultIDGenerator() *defaultIDGenerator {
+	var seed int64
+	if err := binary.Read(cryptorand.Reader, binary.LittleEndian, &seed); err != nil {
+		seed = 1
+	}
+	return &defaultIDGenerator{rand: rand.New(rand.NewSource(seed))}
+}
+
+func (gen *defaultIDGenerator) NewTraceID() (id ttrace.TraceID) {
+	gen.mu.Lock()
+	defer gen.mu.Unlock()
+	for id == (ttrace.TraceID{}) {
+		gen.rand.Read(id[:])
+	}
+	return id
+}
+
+func (gen *defaultIDGenerator) NewSpanID() (id ttrace.SpanID) {
+	gen.mu.Lock()
+	defer gen.mu.Unlock()
+	for id == (ttrace.SpanID{}) {
+		gen.rand.Read(id[:])
+	}
+	return id
+}
+
 // Returns a tracer
 func GetTracer() ttrace.Tracer {
 	opts := []ttrace.TracerOption{
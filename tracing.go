@@ -19,23 +19,22 @@ import (
 	"fmt"
 	"net/url"
 	"os"
-	"strconv"
+	"strings"
 	"time"
 
 	texporter "github.com/GoogleCloudPlatform/opentelemetry-operations-go/exporter/trace"
 	"go.opentelemetry.io/contrib/detectors/gcp"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/jaeger"
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
 	"go.opentelemetry.io/otel/exporters/zipkin"
-	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.10.0"
-	"google.golang.org/grpc"
-	"google.golang.org/grpc/credentials/insecure"
+	ttrace "go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/credentials"
 )
 
 var hostname string
@@ -44,41 +43,259 @@ func init() {
 	hostname, _ = os.Hostname()
 }
 
-// SetupOpenTelemetry sets up tracers based on the `DTRACING` environment variable.
+// SetupOpenTelemetry sets up tracers based on the `SF_TRACING` environment variable.
 //
 // Options are:
 //   - stdout://
 //   - cloudtrace://[host:port]?project_id=<project_id>&ratio=<0.25>
-//   - jaeger://[host:port]?scheme=<http|https>
+//   - jaeger://[host:port]?protocol=<grpc|http> (talks OTLP to Jaeger's
+//     receiver, defaulting to its gRPC port 4317, or 4318 over HTTP)
 //   - zipkin://[host:port]?scheme=<http|https>
-//   - otelcol://[host:port]
+//   - otelcol://[host:port]?tls_cert=&tls_key=&ca_cert=&insecure=&gzip=&retry=&header_<Name>=<value>
+//   - otelhttp://[host:port]?tls_cert=&tls_key=&ca_cert=&insecure=&gzip=&retry=&header_<Name>=<value>
+//   - noop:// / none:// -- explicitly disable tracing; must be the only
+//     entry in `SF_TRACING`, otherwise SetupOpenTelemetry returns an error
+//     instead of silently ignoring the other configured exporters
+//
+// Every scheme above (plus cloudtrace) also accepts `sampler=` and `ratio=`
+// query parameters, e.g. `?sampler=parentbased_traceidratio&ratio=0.01` or
+// `?sampler=rules&rules=[...]&default_ratio=0.05`; see parseSampler for the
+// full set of supported samplers.
+//
+// Any scheme also accepts `tail_error=`, `tail_latency_ms=` and
+// `tail_window=` to switch that exporter from head sampling to tail
+// sampling: spans are buffered per trace for `tail_window` (default 5s) and
+// the whole trace is forwarded only if it contains an error span or a span
+// slower than `tail_latency_ms`, otherwise it's dropped; see
+// tailSamplingSpanProcessor.
+//
+// `SF_TRACING` may also be a comma-separated list of the URLs above, in
+// which case every one of them receives a copy of every span, each
+// exported through its own `BatchSpanProcessor` on a single shared
+// `TracerProvider` -- e.g. `stdout://,otelcol://collector:4317?ratio=0.05`
+// exports full-fidelity traces to stderr for local debugging while only
+// sampling 5% of them to the collector.
+//
+// When `SF_TRACING` is unset, the standard `OTEL_EXPORTER_OTLP_*` environment
+// variables are consulted instead: if `OTEL_EXPORTER_OTLP_ENDPOINT` is set, an
+// OTLP exporter (gRPC, or HTTP when `OTEL_EXPORTER_OTLP_PROTOCOL` is
+// `http/protobuf` or `http/json`) is configured straight from the environment,
+// the same way the upstream OpenTelemetry SDKs do. This lets operators point
+// sf-tracing at a collector without a bespoke `SF_TRACING` URL.
 func SetupOpenTelemetry(ctx context.Context, serviceName string) error {
 	conf := os.Getenv("SF_TRACING")
 	if conf == "" {
+		if os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+			return nil
+		}
+		tp, err := registerOTLPFromEnv(ctx, serviceName)
+		if err != nil {
+			return err
+		}
+		trackProvider(tp)
 		return nil
 	}
-	u, err := url.Parse(conf)
+
+	confs := splitTracingConf(conf)
+	for _, c := range confs {
+		u, err := url.Parse(c)
+		if err != nil {
+			return fmt.Errorf("parsing env var SF_TRACING with value %q: %w", c, err)
+		}
+		if u.Scheme == "noop" || u.Scheme == "none" {
+			if len(confs) > 1 {
+				return fmt.Errorf("env var SF_TRACING: %q cannot be combined with other exporters (got %q)", u.Scheme, conf)
+			}
+			otel.SetTracerProvider(ttrace.NewNoopTracerProvider())
+			return nil
+		}
+	}
+
+	tp, err := registerFanOut(ctx, serviceName, confs)
 	if err != nil {
-		return fmt.Errorf("parsing env var DTRACING with value %q: %w", conf, err)
+		return err
+	}
+
+	trackProvider(tp)
+	return nil
+}
+
+// splitTracingConf splits a (possibly single) comma-separated `SF_TRACING`
+// value into its individual exporter URLs, trimming whitespace and dropping
+// empty entries.
+func splitTracingConf(conf string) []string {
+	parts := strings.Split(conf, ",")
+	out := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	return out
+}
+
+// registerFanOut builds one `BatchSpanProcessor` per entry in confs and
+// registers all of them on a single shared `TracerProvider`, so a single
+// process can export simultaneously to, say, `stdout://` for local
+// debugging and `otelcol://collector:4317` for production.
+//
+// The `TracerProvider` itself always samples everything: per-exporter
+// sampling (the `sampler=`/`ratio=` query parameters on each individual
+// URL) is instead applied at export time by wrapping each processor in a
+// samplingSpanProcessor, which is what lets one exporter stay
+// full-fidelity while another stays ratio-sampled.
+func registerFanOut(ctx context.Context, serviceName string, confs []string) (*trace.TracerProvider, error) {
+	var res *resource.Resource
+	var processors []trace.SpanProcessor
+
+	for _, c := range confs {
+		u, err := url.Parse(c)
+		if err != nil {
+			return nil, fmt.Errorf("parsing env var SF_TRACING with value %q: %w", c, err)
+		}
+
+		exp, sampler, perSpanVarying, err := newExporterAndSampler(ctx, u)
+		if err != nil {
+			return nil, fmt.Errorf("configuring tracing exporter %q: %w", u.Scheme, err)
+		}
+
+		schemeRes, err := resourceForScheme(ctx, u.Scheme, serviceName)
+		if err != nil {
+			return nil, fmt.Errorf("creating resource for %q: %w", u.Scheme, err)
+		}
+		if res == nil {
+			res = schemeRes
+		}
+
+		bsp := trace.NewBatchSpanProcessor(exp)
+
+		tailCfg, err := parseTailSamplingConfig(u)
+		if err != nil {
+			return nil, fmt.Errorf("parsing tail sampling options for %q: %w", u.Scheme, err)
+		}
+		if tailCfg != nil {
+			processors = append(processors, newTailSamplingSpanProcessor(bsp, *tailCfg))
+		} else {
+			processors = append(processors, newSamplingSpanProcessor(bsp, sampler, perSpanVarying))
+		}
+	}
+
+	opts := []trace.TracerProviderOption{
+		trace.WithResource(res),
+		trace.WithSampler(trace.AlwaysSample()),
+	}
+	for _, p := range processors {
+		opts = append(opts, trace.WithSpanProcessor(p))
 	}
 
+	tp := trace.NewTracerProvider(opts...)
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(Propagator())
+
+	return tp, nil
+}
+
+// newExporterAndSampler builds the span exporter and its sampler for a
+// single `SF_TRACING` entry, without installing a `TracerProvider` -- used
+// by registerFanOut so several exporters can share one `TracerProvider`. The
+// third return value is parseSamplerWithDefaultRatio's perSpanVarying.
+func newExporterAndSampler(ctx context.Context, u *url.URL) (trace.SpanExporter, trace.Sampler, bool, error) {
 	switch u.Scheme {
 	case "stdout":
-		return registerStdout(ctx, serviceName, u)
+		exp, err := newStdoutExporter()
+		if err != nil {
+			return nil, nil, false, err
+		}
+		sampler, perSpanVarying, err := parseSamplerWithDefaultRatio(u, 1.0)
+		return exp, sampler, perSpanVarying, err
 	case "cloudtrace":
-		return registerCloudTrace(ctx, serviceName, u)
+		exp, err := newCloudTraceExporter(u)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		sampler, perSpanVarying, err := parseSamplerWithDefaultRatio(u, 0.25)
+		return exp, sampler, perSpanVarying, err
 	case "otelcol":
-		return registerOtelcol(ctx, serviceName, u)
+		exp, err := newOtelcolExporter(ctx, u)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		sampler, perSpanVarying, err := parseSamplerWithDefaultRatio(u, 1.0)
+		return exp, sampler, perSpanVarying, err
+	case "otelhttp":
+		exp, err := newOtelHTTPExporter(ctx, u)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		sampler, perSpanVarying, err := parseSamplerWithDefaultRatio(u, 1.0)
+		return exp, sampler, perSpanVarying, err
 	case "zipkin":
-		return registerZipkin(ctx, serviceName, u)
+		exp, err := newZipkinExporter(u)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		sampler, perSpanVarying, err := parseSamplerWithDefaultRatio(u, 1.0)
+		return exp, sampler, perSpanVarying, err
 	case "jaeger":
-		return registerJaeger(ctx, serviceName, u)
+		exp, err := newJaegerExporter(ctx, u)
+		if err != nil {
+			return nil, nil, false, err
+		}
+		sampler, perSpanVarying, err := parseSamplerWithDefaultRatio(u, 1.0)
+		return exp, sampler, perSpanVarying, err
+	default:
+		return nil, nil, false, fmt.Errorf("unsupported tracing scheme %q", u.Scheme)
+	}
+}
+
+// newResource builds the resource shared by the OTLP-based exporters,
+// picking up `OTEL_RESOURCE_ATTRIBUTES` and `OTEL_SERVICE_NAME` from the
+// environment (the latter overriding `serviceName` when set) on top of the
+// usual telemetry SDK attributes. `WithFromEnv` is applied last since
+// `resource.New` merges its options in order and the later one wins on
+// conflicting keys -- putting it first would let the explicit `serviceName`
+// always clobber `OTEL_SERVICE_NAME`.
+func newResource(ctx context.Context, serviceName string) (*resource.Resource, error) {
+	return resource.New(ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithAttributes(
+			semconv.ServiceNameKey.String(serviceName),
+		),
+		resource.WithFromEnv(),
+	)
+}
+
+// resourceForScheme is newResource, except for the schemes that have always
+// built their resource a little differently (cloudtrace's GCP detector,
+// stdout's extra "environment" attribute).
+func resourceForScheme(ctx context.Context, scheme string, serviceName string) (*resource.Resource, error) {
+	switch scheme {
+	case "cloudtrace":
+		return resource.New(ctx,
+			// Use the GCP resource detector to detect information about the GCP platform
+			resource.WithDetectors(gcp.NewDetector()),
+			// Keep the default detectors
+			resource.WithTelemetrySDK(),
+			// Add your own custom attributes to identify your application
+			resource.WithAttributes(
+				semconv.ServiceNameKey.String(serviceName),
+			),
+		)
+	case "stdout":
+		return resource.Merge(
+			resource.Default(),
+			resource.NewWithAttributes(
+				semconv.SchemaURL,
+				semconv.ServiceNameKey.String(serviceName),
+				attribute.String("environment", os.Getenv("NAMESPACE") /* that won't work, whatever */),
+			),
+		)
 	default:
-		return fmt.Errorf("unsupported tracing scheme %q", u.Scheme)
+		return newResource(ctx, serviceName)
 	}
 }
 
-func registerStdout(ctx context.Context, serviceName string, u *url.URL) error {
+func newStdoutExporter() (trace.SpanExporter, error) {
 	exp, err := stdouttrace.New(
 		stdouttrace.WithWriter(os.Stderr),
 		// Use human-readable output.
@@ -86,196 +303,189 @@ func registerStdout(ctx context.Context, serviceName string, u *url.URL) error {
 		// Do not print timestamps for the demo.
 		stdouttrace.WithoutTimestamps(),
 	)
-
 	if err != nil {
-		return fmt.Errorf("creating stdout exporter: %w", err)
+		return nil, fmt.Errorf("creating stdout exporter: %w", err)
 	}
-
-	res, err := resource.Merge(
-		resource.Default(),
-		resource.NewWithAttributes(
-			semconv.SchemaURL,
-			semconv.ServiceNameKey.String(serviceName),
-			attribute.String("environment", os.Getenv("NAMESPACE") /* that won't work, whatever */),
-		),
-	)
-
-	if err != nil {
-		return fmt.Errorf("creating stdout resource: %w", err)
-	}
-
-	tp := trace.NewTracerProvider(
-		trace.WithBatcher(exp),
-		trace.WithResource(res),
-	)
-	otel.SetTracerProvider(tp)
-
-	return nil
+	return exp, nil
 }
 
-func registerCloudTrace(ctx context.Context, serviceName string, u *url.URL) error {
+func newCloudTraceExporter(u *url.URL) (trace.SpanExporter, error) {
 	projectID := u.Query().Get("project_id")
 	exp, err := texporter.New(texporter.WithProjectID(projectID))
 	if err != nil {
-		return fmt.Errorf("creating cloudtrace exporter: %w", err)
+		return nil, fmt.Errorf("creating cloudtrace exporter: %w", err)
 	}
+	return exp, nil
+}
 
-	// Identify your application using resource detection
-	res, err := resource.New(ctx,
-		// Use the GCP resource detector to detect information about the GCP platform
-		resource.WithDetectors(gcp.NewDetector()),
-		// Keep the default detectors
-		resource.WithTelemetrySDK(),
-		// Add your own custom attributes to identify your application
-		resource.WithAttributes(
-			semconv.ServiceNameKey.String(serviceName),
-		),
-	)
+func newOtelcolExporter(ctx context.Context, u *url.URL) (trace.SpanExporter, error) {
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(u.Host)}
 
+	tlsConfig, err := parseOTLPTLSConfig(u)
 	if err != nil {
-		return fmt.Errorf("creating resource: %w", err)
+		return nil, fmt.Errorf("parsing tls options: %w", err)
+	}
+	if tlsConfig != nil {
+		opts = append(opts, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(tlsConfig)))
+	} else {
+		opts = append(opts, otlptracegrpc.WithInsecure())
 	}
 
-	ratio := 0.25
-	if u.Query().Get("ratio") != "" {
-		ratio, err = strconv.ParseFloat(u.Query().Get("ratio"), 64)
-		if err != nil {
-			return fmt.Errorf("parsing ratio: %w", err)
-		}
+	headers, err := parseOTLPHeaders(u)
+	if err != nil {
+		return nil, fmt.Errorf("parsing headers: %w", err)
+	}
+	if len(headers) > 0 {
+		opts = append(opts, otlptracegrpc.WithHeaders(headers))
 	}
 
-	sampler := trace.TraceIDRatioBased(ratio)
+	if isGzipEnabled(u) {
+		opts = append(opts, otlptracegrpc.WithCompressor("gzip"))
+	}
 
-	tp := trace.NewTracerProvider(
-		trace.WithBatcher(exp),
-		trace.WithResource(res),
-		trace.WithSampler(sampler),
-	)
-	otel.SetTracerProvider(tp)
+	retry, err := parseOTLPRetryConfig(u)
+	if err != nil {
+		return nil, fmt.Errorf("parsing retry options: %w", err)
+	}
+	opts = append(opts, otlptracegrpc.WithRetry(otlptracegrpc.RetryConfig{
+		Enabled:         retry.Enabled,
+		InitialInterval: retry.InitialInterval,
+		MaxInterval:     retry.MaxInterval,
+		MaxElapsedTime:  retry.MaxElapsedTime,
+	}))
+
+	connectCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
-	return nil
+	exp, err := otlptracegrpc.New(connectCtx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	return exp, nil
 }
 
-func registerOtelcol(ctx context.Context, serviceName string, u *url.URL) error {
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			// the service name used to display traces in backends
-			semconv.ServiceNameKey.String(serviceName),
-		),
-	)
-	if err != nil {
-		return fmt.Errorf("failed to create resource: %w", err)
+// newOtelHTTPExporter is the OTLP/HTTP counterpart of newOtelcolExporter,
+// for collectors (Grafana Tempo, Jaeger v2, otel-collector) that only speak
+// OTLP over HTTP or terminate TLS themselves.
+func newOtelHTTPExporter(ctx context.Context, u *url.URL) (trace.SpanExporter, error) {
+	opts := []otlptracehttp.Option{otlptracehttp.WithEndpoint(u.Host)}
+	if path := u.Query().Get("path"); path != "" {
+		opts = append(opts, otlptracehttp.WithURLPath(path))
 	}
 
-	// If the OpenTelemetry Collector is running on a local cluster (minikube or
-	// microk8s), it should be accessible through the NodePort service at the
-	// `localhost:30080` endpoint. Otherwise, replace `localhost` with the
-	// endpoint of your cluster. If you run the app inside k8s, then you can
-	// probably connect directly to the service through dns
-	ctx, cancel := context.WithTimeout(ctx, time.Second)
-	defer cancel()
-	conn, err := grpc.DialContext(ctx, u.Host, grpc.WithTransportCredentials(insecure.NewCredentials()), grpc.WithBlock())
+	tlsConfig, err := parseOTLPTLSConfig(u)
 	if err != nil {
-		return fmt.Errorf("failed to create gRPC connection to collector: %w", err)
+		return nil, fmt.Errorf("parsing tls options: %w", err)
+	}
+	if tlsConfig != nil {
+		opts = append(opts, otlptracehttp.WithTLSClientConfig(tlsConfig))
+	} else {
+		opts = append(opts, otlptracehttp.WithInsecure())
 	}
 
-	// Set up a trace exporter
-	traceExporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithGRPCConn(conn))
+	headers, err := parseOTLPHeaders(u)
 	if err != nil {
-		return fmt.Errorf("failed to create trace exporter: %w", err)
+		return nil, fmt.Errorf("parsing headers: %w", err)
+	}
+	if len(headers) > 0 {
+		opts = append(opts, otlptracehttp.WithHeaders(headers))
 	}
 
-	// Register the trace exporter with a TracerProvider, using a batch
-	// span processor to aggregate spans before export.
-	bsp := trace.NewBatchSpanProcessor(traceExporter)
-	tracerProvider := trace.NewTracerProvider(
-		trace.WithSampler(trace.AlwaysSample()),
-		trace.WithResource(res),
-		trace.WithSpanProcessor(bsp),
-	)
-	otel.SetTracerProvider(tracerProvider)
-
-	// set global propagator to tracecontext (the default is no-op).
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	if isGzipEnabled(u) {
+		opts = append(opts, otlptracehttp.WithCompression(otlptracehttp.GzipCompression))
+	}
 
-	// Shutdown will flush any remaining spans and shut down the exporter.
-	return nil
+	retry, err := parseOTLPRetryConfig(u)
+	if err != nil {
+		return nil, fmt.Errorf("parsing retry options: %w", err)
+	}
+	opts = append(opts, otlptracehttp.WithRetry(otlptracehttp.RetryConfig{
+		Enabled:         retry.Enabled,
+		InitialInterval: retry.InitialInterval,
+		MaxInterval:     retry.MaxInterval,
+		MaxElapsedTime:  retry.MaxElapsedTime,
+	}))
+
+	exp, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+	}
+	return exp, nil
 }
 
-func registerZipkin(ctx context.Context, serviceName string, u *url.URL) error {
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			// the service name used to display traces in backends
-			semconv.ServiceNameKey.String(serviceName),
-		),
+func newZipkinExporter(u *url.URL) (trace.SpanExporter, error) {
+	exp, err := zipkin.New(
+		fmt.Sprintf("%s://%s/api/v2/spans", u.Query().Get("scheme"), u.Host),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create resource: %w", err)
+		return nil, fmt.Errorf("creating zipkin exporter: %w", err)
 	}
+	return exp, nil
+}
 
-	// If the OpenTelemetry Collector is running on a local cluster (minikube or
-	// microk8s), it should be accessible through the NodePort service at the
-	// `localhost:30080` endpoint. Otherwise, replace `localhost` with the
-	// endpoint of your cluster. If you run the app inside k8s, then you can
-	// probably connect directly to the service through dns
-	ctx, cancel := context.WithTimeout(ctx, time.Second)
-	defer cancel()
-
-	// Set up a trace exporter
-	traceExporter, err := zipkin.New(
-		fmt.Sprintf("%s://%s/api/v2/spans", u.Query().Get("scheme"), u.Host),
-	)
+// newJaegerExporter targets Jaeger's OTLP receiver (Jaeger >= 1.35) rather
+// than the `go.opentelemetry.io/otel/exporters/jaeger` package, which is
+// deprecated upstream. The `jaeger://` scheme is kept for backward
+// compatibility: it defaults to Jaeger's OTLP/gRPC port (4317), or OTLP/HTTP
+// on its port (4318) when `?protocol=http` is set.
+func newJaegerExporter(ctx context.Context, u *url.URL) (trace.SpanExporter, error) {
+	host := u.Host
+	if u.Port() == "" {
+		if u.Query().Get("protocol") == "http" {
+			host = host + ":4318"
+		} else {
+			host = host + ":4317"
+		}
+	}
 
-	// Register the trace exporter with a TracerProvider, using a batch
-	// span processor to aggregate spans before export.
-	bsp := trace.NewBatchSpanProcessor(traceExporter)
-	tracerProvider := trace.NewTracerProvider(
-		trace.WithSampler(trace.AlwaysSample()),
-		trace.WithResource(res),
-		trace.WithSpanProcessor(bsp),
-	)
-	otel.SetTracerProvider(tracerProvider)
+	if u.Query().Get("protocol") == "http" {
+		return otlptracehttp.New(ctx, otlptracehttp.WithEndpoint(host), otlptracehttp.WithInsecure())
+	}
 
-	// set global propagator to tracecontext (the default is no-op).
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	connectCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
 
-	// Shutdown will flush any remaining spans and shut down the exporter.
-	return nil
+	exp, err := otlptracegrpc.New(connectCtx, otlptracegrpc.WithEndpoint(host), otlptracegrpc.WithInsecure())
+	if err != nil {
+		return nil, fmt.Errorf("creating jaeger exporter: %w", err)
+	}
+	return exp, nil
 }
 
-func registerJaeger(ctx context.Context, serviceName string, u *url.URL) error {
-	res, err := resource.New(ctx,
-		resource.WithAttributes(
-			// the service name used to display traces in backends
-			semconv.ServiceNameKey.String(serviceName),
-		),
-	)
+// registerOTLPFromEnv configures an OTLP exporter (gRPC or HTTP, selected by
+// `OTEL_EXPORTER_OTLP_PROTOCOL`) purely from the standard `OTEL_*`
+// environment variables, letting the exporters' own envconfig parse
+// `OTEL_EXPORTER_OTLP_ENDPOINT`, `OTEL_EXPORTER_OTLP_HEADERS`, etc.
+func registerOTLPFromEnv(ctx context.Context, serviceName string) (*trace.TracerProvider, error) {
+	res, err := newResource(ctx, serviceName)
 	if err != nil {
-		return fmt.Errorf("failed to create resource: %w", err)
+		return nil, fmt.Errorf("failed to create resource: %w", err)
 	}
 
-	traceExporter, err := jaeger.New(
-		jaeger.WithCollectorEndpoint(
-			jaeger.WithEndpoint(fmt.Sprintf("%s://%s/api/traces", u.Query().Get("scheme"), u.Host)),
-		),
-	)
+	var traceExporter trace.SpanExporter
+	switch os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL") {
+	case "http/protobuf", "http/json":
+		traceExporter, err = otlptracehttp.New(ctx)
+	default:
+		traceExporter, err = otlptracegrpc.New(ctx)
+	}
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("creating otlp exporter from OTEL_* environment variables: %w", err)
+	}
+
+	sampler, err := parseSampler(&url.URL{})
+	if err != nil {
+		return nil, fmt.Errorf("parsing sampler options: %w", err)
 	}
 
-	// Register the trace exporter with a TracerProvider, using a batch
-	// span processor to aggregate spans before export.
 	bsp := trace.NewBatchSpanProcessor(traceExporter)
 	tracerProvider := trace.NewTracerProvider(
-		trace.WithSampler(trace.AlwaysSample()),
+		trace.WithSampler(sampler),
 		trace.WithResource(res),
 		trace.WithSpanProcessor(bsp),
 	)
 	otel.SetTracerProvider(tracerProvider)
+	otel.SetTextMapPropagator(Propagator())
 
-	// set global propagator to tracecontext (the default is no-op).
-	otel.SetTextMapPropagator(propagation.TraceContext{})
-
-	// Shutdown will flush any remaining spans and shut down the exporter.
-	return nil
+	return tracerProvider, nil
 }
@@ -7,6 +7,21 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+func TestSetupOpenTelemetry_NoopRejectsOtherExporters(t *testing.T) {
+	t.Setenv("SF_TRACING", "noop://,stdout://")
+
+	err := SetupOpenTelemetry(context.Background(), "test-service")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "cannot be combined")
+}
+
+func TestSetupOpenTelemetry_NoopAlone(t *testing.T) {
+	t.Setenv("SF_TRACING", "noop://")
+
+	err := SetupOpenTelemetry(context.Background(), "test-service")
+	require.NoError(t, err)
+}
+
 func TestTraceIDContext(t *testing.T) {
 	ctx := context.Background()
 	traceID := NewRandomTraceID()